@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// parseProfileFile reads a legacy "mode: ..." text coverage profile and
+// returns its mode line and the parsed CoverageResult blocks, following the
+// same format main() used to read directly from os.Args. Callers that only
+// need to stream a single profile without buffering it should use
+// scanCoverageResults instead.
+func parseProfileFile(path string) (string, []*CoverageResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanTokenSize)
+
+	if !scanner.Scan() {
+		return "", nil, fmt.Errorf("%s: empty profile", path)
+	}
+	modeStr := strings.Split(scanner.Text(), "mode: ")
+	if len(modeStr) < 2 {
+		return "", nil, fmt.Errorf("%s: missing \"mode: \" header", path)
+	}
+	mode := modeStr[1]
+
+	coverResults := make([]*CoverageResult, 0)
+	for scanner.Scan() {
+		cov, err := parseProfileLine(scanner.Text())
+		if err != nil {
+			return "", nil, err
+		}
+		coverResults = append(coverResults, cov)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	return mode, coverResults, nil
+}
+
+// isCoverDir reports whether path is a Go 1.20+ GOCOVERDIR: a directory
+// holding covmeta.* / covcounters.* files produced by `go build -cover` or
+// GOCOVERDIR, rather than a single legacy "mode: ..." text profile.
+func isCoverDir(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "covmeta.") || strings.HasPrefix(name, "covcounters.") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// textFmtFromCoverDir shells out to `go tool covdata textfmt` to normalize a
+// GOCOVERDIR into the legacy text profile format the rest of the pipeline
+// already understands.
+func textFmtFromCoverDir(dir string) (string, error) {
+	out, err := os.CreateTemp("", "go-cover-coveragepy-*.profile")
+	if err != nil {
+		return "", err
+	}
+	outPath := out.Name()
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("go", "tool", "covdata", "textfmt", "-i="+dir, "-o="+outPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outPath)
+		return "", fmt.Errorf("go tool covdata textfmt: %w", err)
+	}
+
+	return outPath, nil
+}
+
+// resolveProfilePaths normalizes every input (a legacy text profile file or
+// a GOCOVERDIR directory) into a legacy text profile path. On success,
+// cleanup removes any temporary files it created along the way and should be
+// called once the paths are no longer needed; on error those files are
+// already removed and cleanup is nil.
+func resolveProfilePaths(inputs []string) (paths []string, cleanup func(), err error) {
+	var tmpFiles []string
+	cleanup = func() {
+		for _, p := range tmpFiles {
+			os.Remove(p)
+		}
+	}
+
+	for _, input := range inputs {
+		isDir, statErr := isCoverDir(input)
+		if statErr != nil {
+			cleanup()
+			return nil, nil, statErr
+		}
+		if !isDir {
+			paths = append(paths, input)
+			continue
+		}
+
+		textPath, convErr := textFmtFromCoverDir(input)
+		if convErr != nil {
+			cleanup()
+			return nil, nil, convErr
+		}
+		tmpFiles = append(tmpFiles, textPath)
+		paths = append(paths, textPath)
+	}
+
+	return paths, cleanup, nil
+}
+
+// blockKey identifies a coverage block irrespective of which profile it was
+// read from, so the same block reported by multiple binaries can be merged.
+type blockKey struct {
+	Module                                     string
+	StartLine, StartColumn, EndLine, EndColumn uint
+}
+
+// mergeCoverageResults unions counters from several profiles covering the
+// same source tree (e.g. coverage from several integration-test binaries):
+// a block is Reached if any input reached it.
+func mergeCoverageResults(profiles [][]*CoverageResult) []*CoverageResult {
+	order := make([]blockKey, 0)
+	merged := make(map[blockKey]*CoverageResult)
+
+	for _, profile := range profiles {
+		for _, cov := range profile {
+			key := blockKey{cov.Module, cov.StartLine, cov.StartColumn, cov.EndLine, cov.EndColumn}
+			if existing, ok := merged[key]; ok {
+				existing.Reached = existing.Reached || cov.Reached
+				continue
+			}
+			copied := *cov
+			merged[key] = &copied
+			order = append(order, key)
+		}
+	}
+
+	out := make([]*CoverageResult, 0, len(order))
+	for _, key := range order {
+		out = append(out, merged[key])
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsCoverDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := os.Create(filepath.Join(dir, "covmeta.abcd")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	isDir, err := isCoverDir(dir)
+	if err != nil {
+		t.Fatalf("isCoverDir: %v", err)
+	}
+	if !isDir {
+		t.Errorf("isCoverDir(%s) = false, want true", dir)
+	}
+
+	plain := t.TempDir()
+	isDir, err = isCoverDir(plain)
+	if err != nil {
+		t.Fatalf("isCoverDir: %v", err)
+	}
+	if isDir {
+		t.Errorf("isCoverDir(%s) = true, want false", plain)
+	}
+
+	legacy := filepath.Join(dir, "sample.cov")
+	if err := os.WriteFile(legacy, []byte("mode: set\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	isDir, err = isCoverDir(legacy)
+	if err != nil {
+		t.Fatalf("isCoverDir: %v", err)
+	}
+	if isDir {
+		t.Errorf("isCoverDir(%s) = true, want false", legacy)
+	}
+}
+
+// TestMergeCoverageResultsUnionsReached checks that a block reached in any
+// one profile is reported as reached in the merge, and that block identity
+// is keyed on position rather than order, so profiles from different
+// binaries covering the same source merge correctly.
+func TestMergeCoverageResultsUnionsReached(t *testing.T) {
+	profileA := []*CoverageResult{
+		{Module: "example.com/pkg/foo.go", StartLine: 1, EndLine: 3, StmtCount: 2, Reached: true},
+		{Module: "example.com/pkg/foo.go", StartLine: 4, EndLine: 5, StmtCount: 1, Reached: false},
+	}
+	profileB := []*CoverageResult{
+		{Module: "example.com/pkg/foo.go", StartLine: 4, EndLine: 5, StmtCount: 1, Reached: true},
+		{Module: "example.com/pkg/foo.go", StartLine: 1, EndLine: 3, StmtCount: 2, Reached: false},
+	}
+
+	merged := mergeCoverageResults([][]*CoverageResult{profileA, profileB})
+	if len(merged) != 2 {
+		t.Fatalf("want 2 merged blocks, got %d", len(merged))
+	}
+	for _, cov := range merged {
+		if !cov.Reached {
+			t.Errorf("block %+v not reached, want reached (union of the two profiles)", cov)
+		}
+	}
+}
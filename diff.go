@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// changedLineRanges maps a file (either a git-relative path, when the diff
+// came from a git ref, or a coverage Module, when it came from a baseline
+// profile) to the line ranges that changed.
+type changedLineRanges map[string][]CoverRange
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// resolveChangedLines interprets -diff's argument as either a baseline
+// coverage profile (compared against the coverage just collected) or a git
+// ref (compared against the working tree via `git diff`).
+func resolveChangedLines(target string, currentResults []*CoverageResult) (changedLineRanges, error) {
+	if isLegacyProfileFile(target) {
+		_, baseline, err := parseProfileFile(target)
+		if err != nil {
+			return nil, err
+		}
+		return changedLinesFromProfiles(baseline, currentResults), nil
+	}
+	return changedLinesFromGitRef(target)
+}
+
+// isLegacyProfileFile reports whether path looks like a "mode: ..." text
+// coverage profile rather than a git ref.
+func isLegacyProfileFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return false
+	}
+	return strings.HasPrefix(scanner.Text(), "mode: ")
+}
+
+// changedLinesFromGitRef runs `git diff --unified=0 ref` and returns the
+// line ranges added or modified in the working tree relative to ref.
+func changedLinesFromGitRef(ref string) (changedLineRanges, error) {
+	out, err := exec.Command("git", "diff", "--unified=0", ref).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %w", ref, err)
+	}
+	return parseUnifiedDiff(out), nil
+}
+
+// parseUnifiedDiff extracts the added/modified line ranges of each file
+// from a `git diff --unified=0` style patch.
+func parseUnifiedDiff(diff []byte) changedLineRanges {
+	changed := make(changedLineRanges)
+	var currentFile string
+
+	scanner := bufio.NewScanner(strings.NewReader(string(diff)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "+++ ") {
+			path := strings.TrimPrefix(line, "+++ ")
+			currentFile = strings.TrimPrefix(path, "b/")
+			continue
+		}
+
+		m := hunkHeaderRe.FindStringSubmatch(line)
+		if m == nil || currentFile == "" || currentFile == "/dev/null" {
+			continue
+		}
+
+		newStart, _ := strconv.Atoi(m[3])
+		newCount := 1
+		if m[4] != "" {
+			newCount, _ = strconv.Atoi(m[4])
+		}
+		if newCount == 0 {
+			// pure deletion, nothing added to grade coverage against
+			continue
+		}
+		changed[currentFile] = append(changed[currentFile], CoverRange{
+			Start: uint(newStart),
+			End:   uint(newStart + newCount - 1),
+		})
+	}
+
+	return changed
+}
+
+// changedLinesFromProfiles reports every block of current whose reached
+// status differs from baseline or that baseline does not have at all, i.e.
+// the lines that got newly covered (or newly lost) since baseline was
+// recorded, plus blocks new since then.
+func changedLinesFromProfiles(baseline, current []*CoverageResult) changedLineRanges {
+	baseReached := make(map[blockKey]bool, len(baseline))
+	for _, cov := range baseline {
+		baseReached[blockKey{cov.Module, cov.StartLine, cov.StartColumn, cov.EndLine, cov.EndColumn}] = cov.Reached
+	}
+
+	changed := make(changedLineRanges)
+	for _, cov := range current {
+		key := blockKey{cov.Module, cov.StartLine, cov.StartColumn, cov.EndLine, cov.EndColumn}
+		if prev, ok := baseReached[key]; !ok || prev != cov.Reached {
+			changed[cov.Module] = append(changed[cov.Module], CoverRange{Start: cov.StartLine, End: cov.EndLine})
+		}
+	}
+	return changed
+}
+
+// changedRangesForItem looks up item's changed ranges, matching either by
+// exact Module (profile diff) or by git-relative path suffix (git diff).
+func changedRangesForItem(changed changedLineRanges, item *Item) []CoverRange {
+	if ranges, ok := changed[item.DisplayFile]; ok {
+		return ranges
+	}
+	for path, ranges := range changed {
+		if item.DisplayFile == path || strings.HasSuffix(item.DisplayFile, "/"+path) {
+			return ranges
+		}
+	}
+	return nil
+}
+
+// applyPatchCoverage fills in each Item's Patch* fields by intersecting its
+// reached/missed ranges with the lines that changed, and rolls the result
+// up into summary.Total.
+func applyPatchCoverage(summary *Summary, changed changedLineRanges) {
+	var totalPatchReached, totalPatchMissed uint
+	for _, item := range summary.Items {
+		ranges := changedRangesForItem(changed, item)
+		if len(ranges) == 0 {
+			continue
+		}
+		item.HasPatch = true
+
+		for _, r := range ranges {
+			for line := r.Start; line <= r.End; line++ {
+				switch {
+				case item.IsReached(line):
+					item.PatchReached++
+				case item.IsMissed(line):
+					item.PatchMissed++
+				}
+			}
+		}
+
+		if item.PatchReached+item.PatchMissed > 0 {
+			item.PatchPercentage = uint(float64(item.PatchReached) / float64(item.PatchReached+item.PatchMissed) * 100)
+		}
+
+		totalPatchReached += item.PatchReached
+		totalPatchMissed += item.PatchMissed
+	}
+
+	summary.Total.PatchReached = totalPatchReached
+	summary.Total.PatchMissed = totalPatchMissed
+	if totalPatchReached+totalPatchMissed > 0 {
+		summary.Total.PatchPercentage = uint(float64(totalPatchReached) / float64(totalPatchReached+totalPatchMissed) * 100)
+	}
+}
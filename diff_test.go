@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := []byte(`diff --git a/foo.go b/foo.go
+--- a/foo.go
++++ b/foo.go
+@@ -10,2 +10,3 @@ func f() {
+-old line
++new line
++another new line
+@@ -20 +21,0 @@
+-removed only, nothing added
+`)
+
+	changed := parseUnifiedDiff(diff)
+	want := changedLineRanges{
+		"foo.go": []CoverRange{{Start: 10, End: 12}},
+	}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %+v, want %+v", changed, want)
+	}
+}
+
+func TestChangedLinesFromProfiles(t *testing.T) {
+	baseline := []*CoverageResult{
+		{Module: "pkg/foo.go", StartLine: 1, EndLine: 3, StmtCount: 1, Reached: false},
+		{Module: "pkg/foo.go", StartLine: 5, EndLine: 6, StmtCount: 1, Reached: true},
+	}
+	current := []*CoverageResult{
+		// newly reached since baseline
+		{Module: "pkg/foo.go", StartLine: 1, EndLine: 3, StmtCount: 1, Reached: true},
+		// unchanged
+		{Module: "pkg/foo.go", StartLine: 5, EndLine: 6, StmtCount: 1, Reached: true},
+		// new block not present in baseline at all
+		{Module: "pkg/foo.go", StartLine: 8, EndLine: 8, StmtCount: 1, Reached: true},
+	}
+
+	changed := changedLinesFromProfiles(baseline, current)
+	ranges := changed["pkg/foo.go"]
+	if len(ranges) != 2 {
+		t.Fatalf("ranges = %+v, want 2 entries", ranges)
+	}
+	if ranges[0] != (CoverRange{Start: 1, End: 3}) || ranges[1] != (CoverRange{Start: 8, End: 8}) {
+		t.Errorf("ranges = %+v, want [{1 3} {8 8}]", ranges)
+	}
+}
+
+func TestApplyPatchCoverage(t *testing.T) {
+	summary := &Summary{
+		Items: []*Item{
+			{
+				DisplayFile:   "pkg/foo.go",
+				ReachedRanges: []CoverRange{{Start: 1, End: 1}},
+				MissedRanges:  []CoverRange{{Start: 2, End: 2}},
+			},
+		},
+	}
+	changed := changedLineRanges{
+		"pkg/foo.go": []CoverRange{{Start: 1, End: 2}},
+	}
+
+	applyPatchCoverage(summary, changed)
+
+	item := summary.Items[0]
+	if !item.HasPatch {
+		t.Fatal("HasPatch = false, want true")
+	}
+	if item.PatchReached != 1 || item.PatchMissed != 1 || item.PatchPercentage != 50 {
+		t.Errorf("item patch = %+v, want PatchReached=1 PatchMissed=1 PatchPercentage=50", item)
+	}
+	if summary.Total.PatchReached != 1 || summary.Total.PatchMissed != 1 || summary.Total.PatchPercentage != 50 {
+		t.Errorf("total patch = %+v, want PatchReached=1 PatchMissed=1 PatchPercentage=50", summary.Total)
+	}
+}
+
+func TestChangedRangesForItemMatchesGitRelativeSuffix(t *testing.T) {
+	changed := changedLineRanges{
+		"foo.go": []CoverRange{{Start: 1, End: 1}},
+	}
+	item := &Item{DisplayFile: "example.com/pkg/foo.go"}
+
+	ranges := changedRangesForItem(changed, item)
+	if len(ranges) != 1 || ranges[0] != (CoverRange{Start: 1, End: 1}) {
+		t.Errorf("ranges = %+v, want [{1 1}]", ranges)
+	}
+}
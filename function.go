@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+)
+
+// FunctionItem is the per-function coverage result inside a single source
+// file, similar to the rows printed by `go tool cover -func`.
+type FunctionItem struct {
+	Name       string
+	Receiver   string
+	StartLine  uint
+	EndLine    uint
+	Reached    uint
+	Statement  uint // reached + missed
+	Percentage uint // 0-100
+}
+
+// funcDisplayName returns the name as it should be rendered, including the
+// receiver type for methods, e.g. "(*Item).IsReached".
+func (f *FunctionItem) funcDisplayName() string {
+	if f.Receiver == "" {
+		return f.Name
+	}
+	return fmt.Sprintf("(%s).%s", f.Receiver, f.Name)
+}
+
+// receiverName extracts the receiver type name from a FuncDecl, returning
+// "" for plain functions.
+func receiverName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		if ident, ok := star.X.(*ast.Ident); ok {
+			return "*" + ident.Name
+		}
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// funcDeclsInFile parses filename and returns every top-level function and
+// method declaration found in it.
+func funcDeclsInFile(filename string) ([]*ast.FuncDecl, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, filename, nil, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decls := make([]*ast.FuncDecl, 0)
+	for _, decl := range astFile.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			decls = append(decls, funcDecl)
+		}
+	}
+	return decls, fset, nil
+}
+
+// functionCoverage maps the CoverageResult blocks belonging to filename onto
+// the FuncDecls found by parsing it, and returns one FunctionItem per
+// function ordered by StartLine.
+func functionCoverage(filename string, covResults []*CoverageResult) ([]*FunctionItem, error) {
+	decls, fset, err := funcDeclsInFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	funcItems := make([]*FunctionItem, 0, len(decls))
+	for _, decl := range decls {
+		startLine := uint(fset.Position(decl.Pos()).Line)
+		endLine := uint(fset.Position(decl.End()).Line)
+
+		item := &FunctionItem{
+			Name:      decl.Name.Name,
+			Receiver:  receiverName(decl),
+			StartLine: startLine,
+			EndLine:   endLine,
+		}
+
+		for _, cov := range covResults {
+			if cov.StartLine < startLine || cov.EndLine > endLine {
+				continue
+			}
+			item.Statement += cov.StmtCount
+			if cov.Reached {
+				item.Reached += cov.StmtCount
+			}
+		}
+
+		if item.Statement > 0 {
+			item.Percentage = uint(float64(item.Reached) / float64(item.Statement) * 100)
+		} else {
+			item.Percentage = 100
+		}
+
+		funcItems = append(funcItems, item)
+	}
+
+	sort.Slice(funcItems, func(i, j int) bool {
+		return funcItems[i].StartLine < funcItems[j].StartLine
+	})
+
+	return funcItems, nil
+}
+
+// writeFuncReport writes a plain-text `-func`-style report to w, one line
+// per function in the form "file:line:<TAB>function<TAB>percent.0%", where
+// percent is the truncated integer Percentage.
+func writeFuncReport(w io.Writer, items []*Item) error {
+	for _, item := range items {
+		for _, fn := range item.Functions {
+			if _, err := fmt.Fprintf(w, "%s:%d:\t%s\t%d.0%%\n", item.DisplayFile, fn.StartLine, fn.funcDisplayName(), fn.Percentage); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
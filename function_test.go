@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestFunctionCoverageMapsBlocksToDecls checks that functionCoverage maps
+// coverage blocks onto the function they fall inside of, rather than
+// bleeding across function boundaries.
+func TestFunctionCoverageMapsBlocksToDecls(t *testing.T) {
+	filename := filepath.Join("testdata", "sample_funcs.go")
+	coverResults := []*CoverageResult{
+		{StartLine: 3, EndLine: 5, StmtCount: 1, Reached: true},
+		{StartLine: 7, EndLine: 9, StmtCount: 1, Reached: false},
+	}
+
+	funcItems, err := functionCoverage(filename, coverResults)
+	if err != nil {
+		t.Fatalf("functionCoverage: %v", err)
+	}
+	if len(funcItems) != 2 {
+		t.Fatalf("want 2 functions, got %d", len(funcItems))
+	}
+
+	add, sub := funcItems[0], funcItems[1]
+	if add.Name != "Add" || add.Reached != 1 || add.Statement != 1 || add.Percentage != 100 {
+		t.Errorf("Add = %+v, want Name=Add Reached=1 Statement=1 Percentage=100", add)
+	}
+	if sub.Name != "Sub" || sub.Reached != 0 || sub.Statement != 1 || sub.Percentage != 0 {
+		t.Errorf("Sub = %+v, want Name=Sub Reached=0 Statement=1 Percentage=0", sub)
+	}
+}
+
+// TestFunctionCoverageNoCoverDefaultsFull checks that a function with no
+// matching coverage block (e.g. never instrumented) is reported as 100%
+// rather than 0/0.
+func TestFunctionCoverageNoCoverDefaultsFull(t *testing.T) {
+	filename := filepath.Join("testdata", "sample_funcs.go")
+
+	funcItems, err := functionCoverage(filename, nil)
+	if err != nil {
+		t.Fatalf("functionCoverage: %v", err)
+	}
+	for _, fn := range funcItems {
+		if fn.Percentage != 100 {
+			t.Errorf("%s.Percentage = %d, want 100", fn.Name, fn.Percentage)
+		}
+	}
+}
@@ -3,40 +3,18 @@ package main
 import (
 	"bufio"
 	"context"
-	"embed"
 	"flag"
 	"fmt"
-	"html/template"
+	"io"
 	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
-	"sync"
-	textTemplate "text/template"
 	"time"
-
-	"golang.org/x/mod/modfile"
 )
 
-// functions for template
-var funcMap template.FuncMap = template.FuncMap{
-	"add": func(a int, b int) int {
-		return a + b
-	},
-	"strftime": templateStrftime,
-	"getProgressBarBgColor": func(percentage uint) string {
-		if percentage < 30 {
-			return "bg-danger"
-		} else if percentage < 70 {
-			return "bg-warning"
-		}
-		return "bg-success"
-	},
-}
-
 type CoverageResult struct {
 	Module      string
 	StartLine   uint
@@ -63,6 +41,21 @@ type Item struct {
 	All           uint
 	DisplayFile   string
 	HtmlLink      string
+	Functions     []*FunctionItem
+
+	// Patch coverage: Reached/Missed restricted to lines changed relative to
+	// -diff's baseline. HasPatch is false when the file has no changed
+	// lines, so templates can render "-" instead of a 0% patch score.
+	HasPatch        bool
+	PatchReached    uint
+	PatchMissed     uint
+	PatchPercentage uint // 0-100
+
+	// CachePath is set by the streaming pipeline on the index copy of an
+	// Item, whose ReachedRanges and MissedRanges are dropped once the full
+	// Item has been written to this gob file. The file is removed when the
+	// pipeline returns. Empty unless -stream was used.
+	CachePath string
 }
 
 func (item *Item) IsReached(num uint) bool {
@@ -83,10 +76,40 @@ func (item *Item) IsMissed(num uint) bool {
 	return false
 }
 
-type LineItem struct {
-	Text string
-	Type string // run, pln, `mis show_mis`
+// LineCoverage classifies line num for the HTML highlighter. A line
+// touched by both reached and missed blocks (common with inlined
+// generics/closures, where overlapping blocks disagree) is reported as
+// "par" with a tooltip like coverage.py's branch annotations; otherwise
+// it's wholly "run", wholly "mis show_mis", or untouched ("pln").
+func (item *Item) LineCoverage(num uint) (coverType string, tooltip string) {
+	var reached, missed int
+	for _, r := range item.ReachedRanges {
+		if r.Start <= num && r.End >= num {
+			reached++
+		}
+	}
+	for _, r := range item.MissedRanges {
+		if r.Start <= num && r.End >= num {
+			missed++
+		}
+	}
 
+	switch {
+	case reached > 0 && missed > 0:
+		return "par", fmt.Sprintf("%d/%d blocks reached", reached, reached+missed)
+	case reached > 0:
+		return "run", ""
+	case missed > 0:
+		return "mis show_mis", ""
+	default:
+		return "pln", ""
+	}
+}
+
+type LineItem struct {
+	Text    string
+	Type    string // run, pln, `mis show_mis`, par
+	Tooltip string // set for `par`, e.g. "1/2 blocks reached"
 }
 
 type TotalItem struct {
@@ -96,6 +119,10 @@ type TotalItem struct {
 	Missed     uint
 	Excluded   uint
 	All        uint
+
+	PatchReached    uint
+	PatchMissed     uint
+	PatchPercentage uint // 0-100
 }
 
 type Summary struct {
@@ -111,15 +138,8 @@ type FileSummary struct {
 	CreatedAt *time.Time
 }
 
-//go:embed templates
-var f embed.FS
-
 var logger *slog.Logger
 
-func templateStrftime(t *time.Time) string {
-	return t.Format("2006-01-02 15:04 -07:00")
-}
-
 // flatten filename
 //
 // * github.com/user/repo/file.go -> github_com_user_repo_file_go
@@ -129,23 +149,6 @@ func flattenFilename(filename string) string {
 	return base
 }
 
-func parseGoMod(path string) string {
-	gomod := filepath.Join(path, "go.mod")
-	data, err := os.ReadFile(gomod)
-	if err != nil {
-		panic(err)
-	}
-
-	modFile, err := modfile.Parse("go.mod", data, nil)
-	if err != nil {
-		panic(err)
-	}
-
-	packageName := modFile.Module.Mod.Path
-
-	return packageName
-}
-
 func getLines(filename string) ([]string, error) {
 	lines := make([]string, 0)
 	file, err := os.Open(filename)
@@ -162,149 +165,158 @@ func getLines(filename string) ([]string, error) {
 	return lines, nil
 }
 
-func writeTemplateFile(tmpl *template.Template, filename string, data interface{}) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	err = tmpl.Execute(file, data)
-	if err != nil {
-		return err
+// coverResultsForModule returns the subset of covResults belonging to
+// module, preserving their original order.
+func coverResultsForModule(covResults []*CoverageResult, module string) []*CoverageResult {
+	matched := make([]*CoverageResult, 0)
+	for _, cov := range covResults {
+		if cov.Module == module {
+			matched = append(matched, cov)
+		}
 	}
-	return nil
+	return matched
 }
 
-func writeTextTemplateFile(tmpl *textTemplate.Template, filename string, data interface{}) error {
-	file, err := os.Create(filename)
+// moduleFunctionCoverage resolves module's source file on disk and computes
+// its per-function coverage.
+func moduleFunctionCoverage(resolver *SourceResolver, module string, covResults []*CoverageResult) ([]*FunctionItem, error) {
+	filename, err := resolver.Resolve(module)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer file.Close()
-	err = tmpl.Execute(file, data)
-	if err != nil {
-		return err
-	}
-	return nil
+	return functionCoverage(filename, coverResultsForModule(covResults, module))
 }
 
-func writeStaticFiles(outputDir string) error {
-	// js, css, and more...
-	styleFiles := []string{
-		"coverage_html.js",
-		"style.css",
-		"bootstrap.min.css",
-		"bootstrap.bundle.min.js",
-	}
-	for _, styleFile := range styleFiles {
-		tmplStyle, err := textTemplate.ParseFS(f, "templates/"+styleFile)
-		if err != nil {
-			return err
+// summarizeCoverResults groups coverResults by module (profiles are already
+// grouped this way) into one Item each, plus the rolled-up total. Reached
+// and Missed always accumulate StmtCount, never a line span, so file pairs
+// with multi-statement blocks aren't over- or under-counted; line ranges
+// are kept on the side purely for the HTML highlighter.
+func summarizeCoverResults(resolver *SourceResolver, coverResults []*CoverageResult) ([]*Item, TotalItem, error) {
+	items := make([]*Item, 0)
+	var total TotalItem
+
+	var curModule string
+	var lastCov CoverageResult
+	var reachedNum, missedNum uint
+	var reachedRanges, missedRanges []CoverRange
+	var moduleCovResults []*CoverageResult
+	haveModule := false
+
+	flush := func(module string, allNum uint) error {
+		item := &Item{
+			Reached:       reachedNum,
+			Missed:        missedNum,
+			Statement:     reachedNum + missedNum,
+			All:           allNum,
+			DisplayFile:   module,
+			HtmlLink:      flattenFilename(module) + ".html",
+			ReachedRanges: reachedRanges,
+			MissedRanges:  missedRanges,
 		}
-		if err := writeTextTemplateFile(tmplStyle, filepath.Join(outputDir, styleFile), nil); err != nil {
-			return err
+		if item.Statement > 0 {
+			item.Percentage = uint(math.Round(float64(item.Reached) / float64(item.Statement) * 100))
 		}
-	}
 
-	// .gitignore
-	file, err := os.Create(filepath.Join(outputDir, ".gitignore"))
-	if err != nil {
-		return err
-	}
-	if _, err := file.WriteString("*\n"); err != nil {
-		return err
-	}
-	if err := file.Close(); err != nil {
-		return err
-	}
-
-	return nil
-}
+		funcItems, err := moduleFunctionCoverage(resolver, module, moduleCovResults)
+		if err != nil {
+			logger.Error("function coverage error", "module", module, "error", err)
+		} else {
+			item.Functions = funcItems
+		}
 
-func writeIndexFile(outputDir string, summary *Summary) error {
-	// write index.html
-	tmplIndex, err := template.New("index.html").Funcs(funcMap).ParseFS(f, "templates/index.html")
-	if err != nil {
-		return err
+		items = append(items, item)
+		total.Reached += item.Reached
+		total.Missed += item.Missed
+		total.Statement += item.Statement
+		total.All += item.All
+		return nil
 	}
-	if err := writeTemplateFile(tmplIndex, filepath.Join(outputDir, "index.html"), summary); err != nil {
-		return err
-	}
-	return nil
-}
 
-func writeProfileFile(tmplFile *template.Template, outputFilename, packageName string, item *Item, createdAt *time.Time) error {
-	var lineItems []*LineItem
-	var filename string
-	{
-		tmp := strings.Split(item.DisplayFile, packageName)
-		if len(tmp) > 1 {
-			filename = tmp[1]
-		} else {
-			filename = item.DisplayFile
+	for _, cov := range coverResults {
+		if !haveModule {
+			curModule = cov.Module
+			haveModule = true
+		} else if cov.Module != curModule {
+			if err := flush(curModule, lastCov.EndLine); err != nil {
+				return nil, TotalItem{}, err
+			}
+			reachedNum, missedNum = 0, 0
+			reachedRanges, missedRanges = nil, nil
+			moduleCovResults = nil
+			curModule = cov.Module
 		}
-		if filename[0] == '/' {
-			filename = filename[1:]
+
+		if cov.Reached {
+			reachedNum += cov.StmtCount
+			reachedRanges = append(reachedRanges, CoverRange{Start: cov.StartLine, End: cov.EndLine})
+		} else {
+			missedNum += cov.StmtCount
+			missedRanges = append(missedRanges, CoverRange{Start: cov.StartLine, End: cov.EndLine})
 		}
+		moduleCovResults = append(moduleCovResults, cov)
+		lastCov = *cov
 	}
-	lines, err := getLines(filename)
-	if err != nil {
-		return err
-	}
-	for idx, line := range lines {
-		coverType := "pln"
-		if item.IsReached(uint(idx + 1)) {
-			coverType = "run"
-		} else if item.IsMissed(uint(idx + 1)) {
-			coverType = "mis show_mis"
+
+	if haveModule {
+		allNum := lastCov.EndLine
+		if !lastCov.Reached {
+			allNum++
+		}
+		if err := flush(curModule, allNum); err != nil {
+			return nil, TotalItem{}, err
 		}
-		logger.Debug("file.reach", "reach", item.ReachedRanges, "miss", item.MissedRanges, "idx", idx, "line", line, "type", coverType)
-		lineItems = append(lineItems, &LineItem{
-			Text: line,
-			Type: coverType,
-		})
 	}
 
-	if err := writeTemplateFile(tmplFile, outputFilename, &FileSummary{
-		Item:      item,
-		Lines:     lineItems,
-		CreatedAt: createdAt,
-	}); err != nil {
-		return err
+	total.Excluded = total.All - total.Reached - total.Missed
+	if total.Statement > 0 {
+		total.Percentage = uint(math.Round(float64(total.Reached) / float64(total.Statement) * 100))
 	}
 
-	return nil
+	sort.Slice(items, func(i, j int) bool { return items[i].DisplayFile < items[j].DisplayFile })
+
+	return items, total, nil
 }
 
-type WorkerProcessRequest struct {
-	tmplFile       *template.Template
-	outputFilename string
-	packageName    string
-	item           *Item
+// formatTarget is one "-format name[:output]" request, e.g. "json:cov.json"
+// or plain "lcov" (falls back to stdout).
+type formatTarget struct {
+	Name   string
+	Output string
 }
 
-func startWorker(ctx context.Context, wg *sync.WaitGroup, num int) (requestch chan *WorkerProcessRequest) {
-	requestch = make(chan *WorkerProcessRequest)
-
-	for i := 0; i < num; i++ {
-		go func() {
-			for {
-				select {
-				case req := <-requestch:
-					logger.Debug("worker", "path", req.outputFilename)
-					now := time.Now()
-					if err := writeProfileFile(req.tmplFile, req.outputFilename, req.packageName, req.item, &now); err != nil {
-						logger.Error("write profile file error", "error", err)
-					}
-					wg.Done()
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
+// formatFlags collects repeated "-format" flags in the order given.
+type formatFlags []formatTarget
+
+func (f *formatFlags) String() string {
+	return fmt.Sprint([]formatTarget(*f))
+}
+
+func (f *formatFlags) Set(value string) error {
+	name, output, _ := strings.Cut(value, ":")
+	*f = append(*f, formatTarget{Name: name, Output: output})
+	return nil
+}
+
+// reportWriter opens the destination for a non-html format: a file when
+// Output is set, stdout otherwise.
+func reportWriter(target formatTarget) (io.WriteCloser, error) {
+	if target.Output == "" || target.Output == "-" {
+		return os.Stdout, nil
 	}
+	return os.Create(target.Output)
+}
+
+// stringsFlag collects repeated occurrences of a flag into a slice.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return fmt.Sprint([]string(*s))
+}
 
-	return
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 func main() {
@@ -312,21 +324,33 @@ func main() {
 	debugFlag := flag.Bool("d", false, "Enable debug mode")
 	outputDir := flag.String("o", "htmlcov", "Output directory")
 	jobs := flag.Int("jobs", 4, "Number of jobs")
+	funcFlag := flag.Bool("func", false, "Print per-function coverage to stdout, like `go tool cover -func`")
+	var formats formatFlags
+	flag.Var(&formats, "format", "Report format, repeatable: -format=html[:DIR] -format=json[:FILE] -format=lcov[:FILE] -format=cobertura-xml[:FILE] -format=text[:FILE]")
+	var mergeInputs stringsFlag
+	flag.Var(&mergeInputs, "merge", "Additional COVER_FILE or GOCOVERDIR to merge in, repeatable")
+	diffFlag := flag.String("diff", "", "Restrict coverage to lines changed relative to a git ref or a baseline coverage profile")
+	failUnderPatch := flag.Int("fail-under-patch", 0, "Exit non-zero if patch coverage (requires -diff) is below this percentage")
+	streamFlag := flag.Bool("stream", false, "Use a bounded-memory streaming pipeline for a single large profile (html report only, incompatible with -merge/-diff)")
 
 	flag.Parse()
 
 	if *helpFlag {
-		fmt.Printf("Usage: go run main.go [-d] [-o <output directory>] <COVER_FILE>\n\n")
+		fmt.Printf("Usage: go run main.go [-d] [-o <output directory>] [-format NAME[:TARGET]]... <COVER_FILE>\n\n")
 		flag.PrintDefaults()
 		return
 	}
 
 	if flag.NArg() < 1 {
-		fmt.Printf("Usage: go run main.go [-d] [-o <output directory>] <COVER_FILE>\n\n")
+		fmt.Printf("Usage: go run main.go [-d] [-o <output directory>] [-format NAME[:TARGET]]... <COVER_FILE>\n\n")
 		flag.PrintDefaults()
 		return
 	}
 
+	if len(formats) == 0 {
+		formats = formatFlags{{Name: "html", Output: *outputDir}}
+	}
+
 	filename := flag.Arg(0)
 
 	level := new(slog.LevelVar)
@@ -338,266 +362,132 @@ func main() {
 	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
 	logger = slog.New(handler)
 
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Println("file opne error:", err)
-		return
-	}
-	defer file.Close()
-
 	basePath := filepath.Dir(filename)
-	packageName := parseGoMod(basePath)
-	logger.Debug("package name", "name", packageName)
-
-	scanner := bufio.NewScanner(file)
+	if info, statErr := os.Stat(filename); statErr == nil && info.IsDir() {
+		// GOCOVERDIR inputs aren't necessarily siblings of the module the way
+		// a plain profile file is, so resolve packages from the working
+		// directory instead.
+		basePath = "."
+	}
+	resolver := NewSourceResolver(basePath)
 
-	// skip the first line
-	scanner.Scan()
-	firstLine := scanner.Text()
-	// NOTE: mode is not used, now
-	modeStr := strings.Split(firstLine, "mode: ")
-	mode := modeStr[1]
+	inputs := append([]string{filename}, mergeInputs...)
+	profilePaths, cleanupProfiles, err := resolveProfilePaths(inputs)
+	if err != nil {
+		fmt.Println("error occurred:", err)
+		os.Exit(1)
+	}
+	defer cleanupProfiles()
 
-	coverResults := make([]*CoverageResult, 0)
-	for scanner.Scan() {
-		line := scanner.Text()
-		words := strings.Split(line, " ")
-		infos := strings.Split(words[0], ":")
-		module, startEnd := infos[0], infos[1]
-		startEnds := strings.Split(startEnd, ",")
-		stmtCountStr := words[1]
-		reached := words[2]
-		logger.Debug("cover result", "module", module, "start", startEnds[0], "end", startEnds[1], "stmt", stmtCountStr, "reached", reached)
-
-		s := strings.Split(startEnds[0], ".")
-		e := strings.Split(startEnds[1], ".")
-		startLine, err := strconv.Atoi(s[0])
-		if err != nil {
-			fmt.Println("error occurred:", err)
-			return
-		}
-		startColumn, err := strconv.Atoi(s[1])
-		if err != nil {
-			fmt.Println("error occurred:", err)
-			return
-		}
-		endLine, err := strconv.Atoi(e[0])
-		if err != nil {
-			fmt.Println("error occurred:", err)
-			return
+	if *streamFlag {
+		if len(profilePaths) != 1 || len(formats) != 1 || formats[0].Name != "html" || *diffFlag != "" {
+			fmt.Println("error occurred: -stream only supports a single profile, a single -format=html, and no -diff")
+			os.Exit(1)
 		}
-		endColumn, err := strconv.Atoi(e[1])
-		if err != nil {
-			fmt.Println("error occurred:", err)
-			return
+
+		streamOutputDir := formats[0].Output
+		if streamOutputDir == "" {
+			streamOutputDir = "htmlcov"
 		}
-		stmtCount, err := strconv.Atoi(stmtCountStr)
+		summary, err := runStreamingPipeline(profilePaths[0], resolver, streamOutputDir, *jobs)
 		if err != nil {
 			fmt.Println("error occurred:", err)
-			return
+			os.Exit(1)
 		}
 
-		cov := &CoverageResult{
-			Module:      module,
-			StartLine:   uint(startLine),
-			StartColumn: uint(startColumn),
-			EndLine:     uint(endLine),
-			EndColumn:   uint(endColumn),
-			StmtCount:   uint(stmtCount),
-			Reached:     reached != "0",
+		if *funcFlag {
+			if err := writeFuncReport(os.Stdout, summary.Items); err != nil {
+				fmt.Println("error occurred:", err)
+				os.Exit(1)
+			}
 		}
 
-		coverResults = append(coverResults, cov)
+		fmt.Printf("wrote html report to %s\n", streamOutputDir)
+		return
 	}
 
-	if _, err := os.Stat(*outputDir); os.IsNotExist(err) {
-		if err := os.Mkdir(*outputDir, 0755); err != nil {
+	var mode string
+	var coverResults []*CoverageResult
+	if len(profilePaths) == 1 {
+		mode, coverResults, err = parseProfileFile(profilePaths[0])
+		if err != nil {
 			fmt.Println("error occurred:", err)
 			os.Exit(1)
 		}
+	} else {
+		profiles := make([][]*CoverageResult, 0, len(profilePaths))
+		for _, path := range profilePaths {
+			m, results, err := parseProfileFile(path)
+			if err != nil {
+				fmt.Println("error occurred:", err)
+				os.Exit(1)
+			}
+			mode = m
+			profiles = append(profiles, results)
+		}
+		coverResults = mergeCoverageResults(profiles)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	wg := &sync.WaitGroup{}
-	worker := startWorker(ctx, wg, *jobs)
-
-	tmplFile, err := template.New("file.html").Funcs(funcMap).ParseFS(f, "templates/file.html")
+	summaryItems, total, err := summarizeCoverResults(resolver, coverResults)
 	if err != nil {
 		fmt.Println("error occurred:", err)
 		os.Exit(1)
 	}
 
-	// summarize
-	items := make(map[string]*Item)
-	var lastModule string
-	var lastCov CoverageResult
-	var reachedNum, totalReachedNum uint
-	var missedNum, totalMissedNum uint
-	var totalStatementNum uint
-	var reachedRanges, missedRanges []CoverRange
-	// var excludedNum, totalExcludedNum uint
-	var allNum, totalAllNum uint
-	for _, cov := range coverResults {
-		if lastModule == "" {
-			// first cover line
-			if cov.Reached {
-				reachedNum += cov.StmtCount
-				reachedRanges = append(reachedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			} else {
-				missedNum += cov.StmtCount
-				missedRanges = append(missedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			}
-			lastModule = cov.Module
-			items[cov.Module] = &Item{}
-
-			items[lastModule].Reached = reachedNum
-			items[lastModule].Missed = missedNum
-			items[lastModule].Statement = reachedNum + missedNum
-			items[lastModule].All = allNum
-			items[lastModule].Percentage = uint(math.Round(float64(reachedNum) / float64(reachedNum+missedNum) * 100))
-			items[lastModule].DisplayFile = lastModule
-			items[lastModule].HtmlLink = flattenFilename(lastModule) + ".html"
-
-			totalReachedNum += reachedNum
-			totalMissedNum += missedNum
-			totalAllNum += allNum
-		} else if lastModule != "" && lastModule != cov.Module {
-			// for old module
-			items[lastModule].Reached = reachedNum
-			items[lastModule].Missed = missedNum
-			items[lastModule].Statement = reachedNum + missedNum
-			items[lastModule].All = allNum
-			items[lastModule].Percentage = uint(math.Ceil(float64(reachedNum) / float64(reachedNum+missedNum) * 100))
-			items[lastModule].DisplayFile = lastModule
-			items[lastModule].HtmlLink = flattenFilename(lastModule) + ".html"
-			items[lastModule].ReachedRanges = reachedRanges
-			items[lastModule].MissedRanges = missedRanges
-
-			logger.Debug("summary", "module", lastModule, "start", reachedNum, "end", missedNum)
-
-			wg.Add(1)
-			worker <- &WorkerProcessRequest{
-				tmplFile:       tmplFile,
-				outputFilename: filepath.Join(*outputDir, items[lastModule].HtmlLink),
-				packageName:    packageName,
-				item:           items[lastModule],
-			}
-
-			allNum = cov.StmtCount
-			totalReachedNum += reachedNum
-			totalMissedNum += missedNum
-			totalStatementNum += reachedNum + missedNum
-			totalAllNum += allNum
-
-			reachedNum = 0
-			missedNum = 0
-			reachedRanges = make([]CoverRange, 0)
-			missedRanges = make([]CoverRange, 0)
-
-			// for new module
-			items[cov.Module] = &Item{}
-
-			if cov.Reached {
-				reachedNum += cov.EndLine - cov.StartLine
-				reachedRanges = append(reachedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			} else {
-				missedNum += cov.EndLine - cov.StartLine
-				missedRanges = append(missedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			}
-		} else {
-			if cov.Reached {
-				reachedNum += cov.StmtCount
-				reachedRanges = append(reachedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			} else {
-				missedNum += cov.StmtCount
-				missedRanges = append(missedRanges, CoverRange{cov.StartLine, cov.EndLine})
-			}
-		}
-		lastModule = cov.Module
-		lastCov = *cov
-	}
-
-	// care of last item
-	allNum = lastCov.EndLine
-	if !lastCov.Reached {
-		allNum += 1
-	}
-	// reachedNum = allNum - missedNum
-	items[lastModule].Reached = reachedNum
-	items[lastModule].Missed = missedNum
-	items[lastModule].Statement = reachedNum + missedNum
-	items[lastModule].All = allNum
-	// items[lastModule].Excluded = allNum - reachedNum - missedNum
-	items[lastModule].Percentage = uint(math.Round(float64(reachedNum) / float64(reachedNum+missedNum) * 100.))
-	items[lastModule].DisplayFile = lastModule
-	items[lastModule].HtmlLink = flattenFilename(lastModule) + ".html"
-	if lastCov.Reached {
-		reachedNum += lastCov.EndLine - lastCov.StartLine
-		reachedRanges = append(reachedRanges, CoverRange{lastCov.StartLine, lastCov.EndLine})
-	} else {
-		missedNum += lastCov.EndLine - lastCov.StartLine
-		missedRanges = append(missedRanges, CoverRange{lastCov.StartLine, lastCov.EndLine})
-	}
-	items[lastModule].ReachedRanges = reachedRanges
-	items[lastModule].MissedRanges = missedRanges
-	logger.Debug("last", "module", lastModule, "reach", reachedNum, "missed", missedNum, "all", allNum)
-	logger.Debug("last.percentage", "percentage", uint(math.Round(float64(reachedNum)/float64(reachedNum+missedNum)*100.)))
-
-	wg.Add(1)
-	worker <- &WorkerProcessRequest{
-		tmplFile:       tmplFile,
-		outputFilename: filepath.Join(*outputDir, items[lastModule].HtmlLink),
-		packageName:    packageName,
-		item:           items[lastModule],
-	}
-
-	totalReachedNum += reachedNum
-	totalMissedNum += missedNum
-	totalStatementNum += reachedNum + missedNum
-	totalAllNum += allNum
-
-	logger.Debug("total", "reach", totalReachedNum, "missed", totalMissedNum, "all", totalAllNum)
-
-	summaryItems := make([]*Item, 0, len(items))
-	for _, v := range items {
-		summaryItems = append(summaryItems, v)
-	}
-
-	sortFunc := func(i, j int) bool {
-		return summaryItems[i].DisplayFile < summaryItems[j].DisplayFile
-	}
-	sort.Slice(summaryItems, sortFunc)
-
 	now := time.Now()
 	summary := &Summary{
-		Mode: mode,
-		Total: TotalItem{
-			All:        totalAllNum,
-			Statement:  totalStatementNum,
-			Reached:    totalReachedNum,
-			Missed:     totalMissedNum,
-			Excluded:   totalAllNum - totalReachedNum - totalMissedNum,
-			Percentage: uint(math.Round(float64(totalReachedNum) / float64(totalStatementNum) * 100)),
-		},
+		Mode:      mode,
+		Total:     total,
 		Items:     summaryItems,
 		CreatedAt: &now,
 	}
 
-	if err := writeIndexFile(*outputDir, summary); err != nil {
-		fmt.Println("error occurred:", err)
-		os.Exit(1)
+	if *funcFlag {
+		if err := writeFuncReport(os.Stdout, summary.Items); err != nil {
+			fmt.Println("error occurred:", err)
+			os.Exit(1)
+		}
 	}
 
-	if err := writeStaticFiles(*outputDir); err != nil {
-		fmt.Println("error occurred:", err)
-		os.Exit(1)
+	if *diffFlag != "" {
+		changed, err := resolveChangedLines(*diffFlag, coverResults)
+		if err != nil {
+			fmt.Println("error occurred:", err)
+			os.Exit(1)
+		}
+		applyPatchCoverage(summary, changed)
+
+		if *failUnderPatch > 0 && summary.Total.PatchPercentage < uint(*failUnderPatch) {
+			fmt.Printf("patch coverage %d%% is below -fail-under-patch %d%%\n", summary.Total.PatchPercentage, *failUnderPatch)
+			os.Exit(1)
+		}
 	}
 
-	wg.Wait()
+	ctx := context.Background()
+	for _, target := range formats {
+		reporter, err := ReporterFor(target.Name, target.Output, resolver, *jobs)
+		if err != nil {
+			fmt.Println("error occurred:", err)
+			os.Exit(1)
+		}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println("error occured:", err)
+		// the html reporter renders a tree of files under its own output
+		// directory rather than a single stream, so the writer it receives
+		// is only used for a short completion message.
+		var w io.WriteCloser = os.Stdout
+		if target.Name != "html" {
+			w, err = reportWriter(target)
+			if err != nil {
+				fmt.Println("error occurred:", err)
+				os.Exit(1)
+			}
+		}
+		if err := reporter.Report(ctx, summary, w); err != nil {
+			fmt.Println("error occurred:", err)
+			os.Exit(1)
+		}
+		if w != os.Stdout {
+			w.Close()
+		}
 	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// TestSummarizeCoverResultsCountsStatements guards against the regression
+// this fixed: the aggregator used to add cov.EndLine-cov.StartLine instead
+// of cov.StmtCount on module transitions, silently under/over-counting
+// multi-statement blocks.
+func TestSummarizeCoverResultsCountsStatements(t *testing.T) {
+	resolver := NewSourceResolver(".")
+
+	_, coverResults, err := parseProfileFile(filepath.Join("testdata", "sample.cov"))
+	if err != nil {
+		t.Fatalf("parseProfileFile: %v", err)
+	}
+
+	items, total, err := summarizeCoverResults(resolver, coverResults)
+	if err != nil {
+		t.Fatalf("summarizeCoverResults: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("want 2 items, got %d", len(items))
+	}
+
+	bar, foo := items[0], items[1]
+	if bar.DisplayFile != "example.com/pkg/bar.go" {
+		t.Fatalf("items[0] = %s, want bar.go", bar.DisplayFile)
+	}
+	if bar.Reached != 1 || bar.Missed != 3 || bar.Statement != 4 || bar.Percentage != 25 {
+		t.Errorf("bar.go = %+v, want Reached=1 Missed=3 Statement=4 Percentage=25", bar)
+	}
+
+	if foo.DisplayFile != "example.com/pkg/foo.go" {
+		t.Fatalf("items[1] = %s, want foo.go", foo.DisplayFile)
+	}
+	// foo.go's first block spans lines 1-5 but only reports 3 statements;
+	// the old EndLine-StartLine arithmetic would have counted 4 here.
+	if foo.Reached != 3 || foo.Missed != 1 || foo.Statement != 4 || foo.Percentage != 75 {
+		t.Errorf("foo.go = %+v, want Reached=3 Missed=1 Statement=4 Percentage=75", foo)
+	}
+
+	if total.Reached != 4 || total.Missed != 4 || total.Statement != 8 || total.Percentage != 50 {
+		t.Errorf("total = %+v, want Reached=4 Missed=4 Statement=8 Percentage=50", total)
+	}
+}
+
+// TestItemLineCoveragePartial covers a line reached by one block and missed
+// by another overlapping block (e.g. inlined generics/closures), which
+// should render as the distinct "par" class rather than "run" or "mis".
+func TestItemLineCoveragePartial(t *testing.T) {
+	item := &Item{
+		ReachedRanges: []CoverRange{{Start: 1, End: 3}},
+		MissedRanges:  []CoverRange{{Start: 1, End: 3}},
+	}
+
+	coverType, tooltip := item.LineCoverage(2)
+	if coverType != "par" {
+		t.Fatalf("coverType = %q, want par", coverType)
+	}
+	if tooltip != "1/2 blocks reached" {
+		t.Fatalf("tooltip = %q, want %q", tooltip, "1/2 blocks reached")
+	}
+}
+
+func TestItemLineCoverageSingleSided(t *testing.T) {
+	item := &Item{
+		ReachedRanges: []CoverRange{{Start: 1, End: 5}},
+		MissedRanges:  []CoverRange{{Start: 6, End: 6}},
+	}
+
+	if coverType, _ := item.LineCoverage(1); coverType != "run" {
+		t.Errorf("line 1 coverType = %q, want run", coverType)
+	}
+	if coverType, _ := item.LineCoverage(6); coverType != "mis show_mis" {
+		t.Errorf("line 6 coverType = %q, want \"mis show_mis\"", coverType)
+	}
+	if coverType, _ := item.LineCoverage(10); coverType != "pln" {
+		t.Errorf("line 10 coverType = %q, want pln", coverType)
+	}
+}
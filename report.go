@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	textTemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var f embed.FS
+
+// Reporter writes a Summary out in some report format, similar in spirit to
+// golangci-lint's printer package. Implementations that need more than a
+// single output stream (html) keep their own output location and treat w as
+// a place to report a short completion message.
+type Reporter interface {
+	Report(ctx context.Context, summary *Summary, w io.Writer) error
+}
+
+// ReporterFor resolves a -format name to its Reporter implementation.
+// outputDir is only meaningful for the "html" format, which renders a tree
+// of files rather than a single stream.
+func ReporterFor(name, outputDir string, resolver *SourceResolver, jobs int) (Reporter, error) {
+	switch name {
+	case "html":
+		if outputDir == "" {
+			outputDir = "htmlcov"
+		}
+		return &HTMLReporter{OutputDir: outputDir, Resolver: resolver, Jobs: jobs}, nil
+	case "json":
+		return &JSONReporter{}, nil
+	case "lcov":
+		return &LCOVReporter{}, nil
+	case "cobertura-xml":
+		return &CoberturaReporter{}, nil
+	case "text":
+		return &TextReporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown report format: %s", name)
+	}
+}
+
+// functions for template
+var funcMap template.FuncMap = template.FuncMap{
+	"add": func(a int, b int) int {
+		return a + b
+	},
+	"strftime": templateStrftime,
+	"getProgressBarBgColor": func(percentage uint) string {
+		if percentage < 30 {
+			return "bg-danger"
+		} else if percentage < 70 {
+			return "bg-warning"
+		}
+		return "bg-success"
+	},
+}
+
+func templateStrftime(t *time.Time) string {
+	return t.Format("2006-01-02 15:04 -07:00")
+}
+
+// HTMLReporter renders the coverage.py-style HTML report: an index page, a
+// per-function summary page, and one annotated source page per file.
+type HTMLReporter struct {
+	OutputDir string
+	Resolver  *SourceResolver
+	Jobs      int
+}
+
+func (r *HTMLReporter) jobs() int {
+	if r.Jobs <= 0 {
+		return 1
+	}
+	return r.Jobs
+}
+
+func (r *HTMLReporter) Report(ctx context.Context, summary *Summary, w io.Writer) error {
+	if _, err := os.Stat(r.OutputDir); os.IsNotExist(err) {
+		if err := os.Mkdir(r.OutputDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	worker := startWorker(workerCtx, wg, r.jobs())
+
+	tmplFile, err := template.New("file.html").Funcs(funcMap).ParseFS(f, "templates/file.html")
+	if err != nil {
+		return err
+	}
+
+	for _, item := range summary.Items {
+		wg.Add(1)
+		worker <- &WorkerProcessRequest{
+			tmplFile:       tmplFile,
+			outputFilename: filepath.Join(r.OutputDir, item.HtmlLink),
+			resolver:       r.Resolver,
+			item:           item,
+		}
+	}
+	wg.Wait()
+
+	if err := writeIndexFile(r.OutputDir, summary); err != nil {
+		return err
+	}
+	if err := writeFunctionsFile(r.OutputDir, summary); err != nil {
+		return err
+	}
+	if err := writeStaticFiles(r.OutputDir); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "wrote html report to %s\n", r.OutputDir)
+	return err
+}
+
+func writeIndexFile(outputDir string, summary *Summary) error {
+	// write index.html
+	tmplIndex, err := template.New("index.html").Funcs(funcMap).ParseFS(f, "templates/index.html")
+	if err != nil {
+		return err
+	}
+	if err := writeTemplateFile(tmplIndex, filepath.Join(outputDir, "index.html"), summary); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeFunctionsFile(outputDir string, summary *Summary) error {
+	// write functions.html
+	tmplFunctions, err := template.New("functions.html").Funcs(funcMap).ParseFS(f, "templates/functions.html")
+	if err != nil {
+		return err
+	}
+	if err := writeTemplateFile(tmplFunctions, filepath.Join(outputDir, "functions.html"), summary); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeTemplateFile(tmpl *template.Template, filename string, data interface{}) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tmpl.Execute(file, data)
+}
+
+func writeTextTemplateFile(tmpl *textTemplate.Template, filename string, data interface{}) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tmpl.Execute(file, data)
+}
+
+func writeStaticFiles(outputDir string) error {
+	// js, css, and more...
+	styleFiles := []string{
+		"coverage_html.js",
+		"style.css",
+		"bootstrap.min.css",
+		"bootstrap.bundle.min.js",
+	}
+	for _, styleFile := range styleFiles {
+		tmplStyle, err := textTemplate.ParseFS(f, "templates/"+styleFile)
+		if err != nil {
+			return err
+		}
+		if err := writeTextTemplateFile(tmplStyle, filepath.Join(outputDir, styleFile), nil); err != nil {
+			return err
+		}
+	}
+
+	// .gitignore
+	file, err := os.Create(filepath.Join(outputDir, ".gitignore"))
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString("*\n"); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeProfileFile(tmplFile *template.Template, outputFilename string, resolver *SourceResolver, item *Item, createdAt *time.Time) error {
+	var lineItems []*LineItem
+	filename, err := resolver.Resolve(item.DisplayFile)
+	if err != nil {
+		return err
+	}
+	lines, err := getLines(filename)
+	if err != nil {
+		return err
+	}
+	for idx, line := range lines {
+		coverType, tooltip := item.LineCoverage(uint(idx + 1))
+		logger.Debug("file.reach", "reach", item.ReachedRanges, "miss", item.MissedRanges, "idx", idx, "line", line, "type", coverType)
+		lineItems = append(lineItems, &LineItem{
+			Text:    line,
+			Type:    coverType,
+			Tooltip: tooltip,
+		})
+	}
+
+	if err := writeTemplateFile(tmplFile, outputFilename, &FileSummary{
+		Item:      item,
+		Lines:     lineItems,
+		CreatedAt: createdAt,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type WorkerProcessRequest struct {
+	tmplFile       *template.Template
+	outputFilename string
+	resolver       *SourceResolver
+	item           *Item
+}
+
+func startWorker(ctx context.Context, wg *sync.WaitGroup, num int) (requestch chan *WorkerProcessRequest) {
+	requestch = make(chan *WorkerProcessRequest)
+
+	for i := 0; i < num; i++ {
+		go func() {
+			for {
+				select {
+				case req := <-requestch:
+					logger.Debug("worker", "path", req.outputFilename)
+					now := time.Now()
+					if err := writeProfileFile(req.tmplFile, req.outputFilename, req.resolver, req.item, &now); err != nil {
+						logger.Error("write profile file error", "error", err)
+					}
+					wg.Done()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	return
+}
+
+// JSONReporter dumps the Summary as-is, for tooling that wants the raw
+// coverage data rather than a rendered report.
+type JSONReporter struct{}
+
+func (r *JSONReporter) Report(ctx context.Context, summary *Summary, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summary)
+}
+
+// TextReporter prints one "file\tpercent%" line per item plus a total line,
+// suitable for eyeballing in a terminal or grepping in CI.
+type TextReporter struct{}
+
+func (r *TextReporter) Report(ctx context.Context, summary *Summary, w io.Writer) error {
+	for _, item := range summary.Items {
+		if _, err := fmt.Fprintf(w, "%s\t%s%%\n", item.DisplayFile, getPercentageValue(item.Reached, item.Statement, 1)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "total\t%s%%\n", getPercentageValue(summary.Total.Reached, summary.Total.Statement, 1))
+	return err
+}
+
+// lcovLine is one LCOV DA: record.
+type lcovLine struct {
+	Number uint
+	Hits   uint
+}
+
+// lcovLinesForItem flattens an Item's reached/missed ranges into one DA
+// record per covered line, since the coverage profile only gives us
+// hit/not-hit per block rather than a per-line hit count.
+func lcovLinesForItem(item *Item) []lcovLine {
+	hits := make(map[uint]uint)
+	for _, r := range item.MissedRanges {
+		for n := r.Start; n <= r.End; n++ {
+			if _, ok := hits[n]; !ok {
+				hits[n] = 0
+			}
+		}
+	}
+	for _, r := range item.ReachedRanges {
+		for n := r.Start; n <= r.End; n++ {
+			hits[n] = 1
+		}
+	}
+
+	lines := make([]uint, 0, len(hits))
+	for n := range hits {
+		lines = append(lines, n)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+
+	result := make([]lcovLine, 0, len(lines))
+	for _, n := range lines {
+		result = append(result, lcovLine{Number: n, Hits: hits[n]})
+	}
+	return result
+}
+
+// LCOVReporter emits the standard SF:/DA:/LF:/LH:/end_of_record records
+// consumed by genhtml, Codecov, and Coveralls.
+type LCOVReporter struct{}
+
+func (r *LCOVReporter) Report(ctx context.Context, summary *Summary, w io.Writer) error {
+	for _, item := range summary.Items {
+		if _, err := fmt.Fprintf(w, "SF:%s\n", item.DisplayFile); err != nil {
+			return err
+		}
+
+		linesFound, linesHit := 0, 0
+		for _, ln := range lcovLinesForItem(item) {
+			if _, err := fmt.Fprintf(w, "DA:%d,%d\n", ln.Number, ln.Hits); err != nil {
+				return err
+			}
+			linesFound++
+			if ln.Hits > 0 {
+				linesHit++
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", linesFound, linesHit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cobertura XML schema, trimmed to the elements Jenkins/GitLab's coverage
+// widgets actually read.
+type coberturaCoverage struct {
+	XMLName    xml.Name          `xml:"coverage"`
+	LineRate   float64           `xml:"line-rate,attr"`
+	BranchRate float64           `xml:"branch-rate,attr"`
+	Packages   coberturaPackages `xml:"packages"`
+	Timestamp  int64             `xml:"timestamp,attr"`
+}
+
+type coberturaPackages struct {
+	Package []coberturaPackage `xml:"package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Classes    coberturaClasses `xml:"classes"`
+}
+
+type coberturaClasses struct {
+	Class []coberturaClass `xml:"class"`
+}
+
+type coberturaClass struct {
+	Name       string         `xml:"name,attr"`
+	Filename   string         `xml:"filename,attr"`
+	LineRate   float64        `xml:"line-rate,attr"`
+	BranchRate float64        `xml:"branch-rate,attr"`
+	Lines      coberturaLines `xml:"lines"`
+}
+
+type coberturaLines struct {
+	Line []coberturaLineHit `xml:"line"`
+}
+
+type coberturaLineHit struct {
+	Number uint `xml:"number,attr"`
+	Hits   uint `xml:"hits,attr"`
+}
+
+// CoberturaReporter emits <coverage><packages><package><classes><class>
+// <lines> XML for CI systems that understand the Cobertura format.
+type CoberturaReporter struct{}
+
+func (r *CoberturaReporter) Report(ctx context.Context, summary *Summary, w io.Writer) error {
+	totalRate := float64(summary.Total.Percentage) / 100
+	cov := coberturaCoverage{
+		LineRate: totalRate,
+		// This tool has no branch data, so branch-rate stands in as a copy
+		// of line-rate rather than being omitted, since some Cobertura
+		// consumers treat a missing branch-rate as 0% instead of N/A.
+		BranchRate: totalRate,
+	}
+	if summary.CreatedAt != nil {
+		cov.Timestamp = summary.CreatedAt.Unix()
+	}
+
+	for _, item := range summary.Items {
+		lineRate := float64(item.Percentage) / 100
+		class := coberturaClass{
+			Name:       item.DisplayFile,
+			Filename:   item.DisplayFile,
+			LineRate:   lineRate,
+			BranchRate: lineRate,
+		}
+		for _, ln := range lcovLinesForItem(item) {
+			class.Lines.Line = append(class.Lines.Line, coberturaLineHit{Number: ln.Number, Hits: ln.Hits})
+		}
+
+		cov.Packages.Package = append(cov.Packages.Package, coberturaPackage{
+			Name:       item.DisplayFile,
+			LineRate:   lineRate,
+			BranchRate: lineRate,
+			Classes:    coberturaClasses{Class: []coberturaClass{class}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(cov); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLcovLinesForItemFlattensOverlappingRanges checks that a line touched
+// by both a reached and a missed range (overlapping blocks disagreeing, the
+// same case LineCoverage's "par" class covers) is flattened to a single hit
+// DA record rather than being reported twice or dropped.
+func TestLcovLinesForItemFlattensOverlappingRanges(t *testing.T) {
+	item := &Item{
+		ReachedRanges: []CoverRange{{Start: 2, End: 2}},
+		MissedRanges:  []CoverRange{{Start: 1, End: 2}, {Start: 4, End: 4}},
+	}
+
+	lines := lcovLinesForItem(item)
+	want := []lcovLine{{Number: 1, Hits: 0}, {Number: 2, Hits: 1}, {Number: 4, Hits: 0}}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %+v, want %+v", lines, want)
+	}
+	for i, got := range lines {
+		if got != want[i] {
+			t.Errorf("lines[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestLCOVReporterReport(t *testing.T) {
+	summary := &Summary{
+		Items: []*Item{
+			{
+				DisplayFile:   "example.com/pkg/foo.go",
+				ReachedRanges: []CoverRange{{Start: 1, End: 2}},
+				MissedRanges:  []CoverRange{{Start: 3, End: 3}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (&LCOVReporter{}).Report(context.Background(), summary, &buf); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	want := "SF:example.com/pkg/foo.go\nDA:1,1\nDA:2,1\nDA:3,0\nLF:3\nLH:2\nend_of_record\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCoberturaReporterReport(t *testing.T) {
+	summary := &Summary{
+		Total: TotalItem{Percentage: 50},
+		Items: []*Item{
+			{
+				DisplayFile:   "example.com/pkg/foo.go",
+				Percentage:    100,
+				ReachedRanges: []CoverRange{{Start: 1, End: 1}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (&CoberturaReporter{}).Report(context.Background(), summary, &buf); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	var cov coberturaCoverage
+	body := strings.TrimPrefix(buf.String(), xml.Header)
+	if err := xml.Unmarshal([]byte(body), &cov); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	if cov.LineRate != 0.5 || cov.BranchRate != 0.5 {
+		t.Errorf("coverage line-rate/branch-rate = %v/%v, want 0.5/0.5", cov.LineRate, cov.BranchRate)
+	}
+	if len(cov.Packages.Package) != 1 {
+		t.Fatalf("want 1 package, got %d", len(cov.Packages.Package))
+	}
+	pkg := cov.Packages.Package[0]
+	if pkg.LineRate != 1 || pkg.BranchRate != 1 {
+		t.Errorf("package line-rate/branch-rate = %v/%v, want 1/1", pkg.LineRate, pkg.BranchRate)
+	}
+}
+
+// TestHTMLReporterReportEndToEnd renders a full report against a real
+// source file (a standard-library file, so it doesn't depend on this
+// module's own layout) and checks every file the pipeline is supposed
+// to produce actually lands on disk. This is the path every other HTML
+// feature (function view, partial-coverage highlighting, patch column)
+// sits on top of, so a broken template here breaks all of them silently.
+func TestHTMLReporterReportEndToEnd(t *testing.T) {
+	outputDir := t.TempDir()
+	now := time.Now()
+	summary := &Summary{
+		Total: TotalItem{Percentage: 60},
+		Items: []*Item{
+			{
+				DisplayFile:   "fmt/print.go",
+				Percentage:    60,
+				HtmlLink:      flattenFilename("fmt/print.go") + ".html",
+				ReachedRanges: []CoverRange{{Start: 1, End: 3}},
+				MissedRanges:  []CoverRange{{Start: 4, End: 4}},
+			},
+		},
+		CreatedAt: &now,
+	}
+
+	reporter := &HTMLReporter{OutputDir: outputDir, Resolver: NewSourceResolver("."), Jobs: 1}
+	var buf bytes.Buffer
+	if err := reporter.Report(context.Background(), summary, &buf); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	for _, name := range []string{
+		"index.html",
+		"functions.html",
+		"style.css",
+		"bootstrap.min.css",
+		"bootstrap.bundle.min.js",
+		"coverage_html.js",
+		flattenFilename("fmt/print.go") + ".html",
+	} {
+		path := filepath.Join(outputDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", path)
+		}
+	}
+
+	body, err := os.ReadFile(filepath.Join(outputDir, flattenFilename("fmt/print.go")+".html"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, class := range []string{`class="run"`, `class="mis show_mis"`} {
+		if !strings.Contains(string(body), class) {
+			t.Errorf("file.html output missing highlighted line class %q", class)
+		}
+	}
+}
+
+// TestFileHTMLRendersFunctionSection checks that a file with FunctionItems
+// gets the per-file collapsible function section, listing the function's
+// name, in its rendered page. The case of a file with no FunctionItems is
+// not exercised here.
+func TestFileHTMLRendersFunctionSection(t *testing.T) {
+	outputDir := t.TempDir()
+	now := time.Now()
+	summary := &Summary{
+		Items: []*Item{
+			{
+				DisplayFile: "fmt/print.go",
+				HtmlLink:    flattenFilename("fmt/print.go") + ".html",
+				Functions: []*FunctionItem{
+					{Name: "Sprintf", StartLine: 1, Reached: 2, Statement: 2, Percentage: 100},
+				},
+			},
+		},
+		CreatedAt: &now,
+	}
+
+	reporter := &HTMLReporter{OutputDir: outputDir, Resolver: NewSourceResolver("."), Jobs: 1}
+	var buf bytes.Buffer
+	if err := reporter.Report(context.Background(), summary, &buf); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join(outputDir, flattenFilename("fmt/print.go")+".html"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(body), `<details class="file-functions">`) {
+		t.Error("file.html output missing the per-file collapsible function section")
+	}
+	if !strings.Contains(string(body), "Sprintf") {
+		t.Error("file.html output missing the function name in the collapsible section")
+	}
+}
+
+// TestFileHTMLRendersPartialCoverageTooltip checks that a line covered by
+// overlapping reached/missed blocks renders the "par" class and its
+// "n/m blocks reached" tooltip in the actual HTML output, not just in the
+// LineCoverage unit tests.
+func TestFileHTMLRendersPartialCoverageTooltip(t *testing.T) {
+	outputDir := t.TempDir()
+	now := time.Now()
+	summary := &Summary{
+		Items: []*Item{
+			{
+				DisplayFile:   "fmt/print.go",
+				HtmlLink:      flattenFilename("fmt/print.go") + ".html",
+				ReachedRanges: []CoverRange{{Start: 2, End: 2}},
+				MissedRanges:  []CoverRange{{Start: 2, End: 2}},
+			},
+		},
+		CreatedAt: &now,
+	}
+
+	reporter := &HTMLReporter{OutputDir: outputDir, Resolver: NewSourceResolver("."), Jobs: 1}
+	var buf bytes.Buffer
+	if err := reporter.Report(context.Background(), summary, &buf); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join(outputDir, flattenFilename("fmt/print.go")+".html"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(body), `class="par"`) {
+		t.Error("file.html output missing the par class for an overlapping reached/missed line")
+	}
+	if !strings.Contains(string(body), `title="1/2 blocks reached"`) {
+		t.Error("file.html output missing the partial-coverage tooltip")
+	}
+}
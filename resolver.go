@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// SourceResolver maps a coverage module's display file (an import path plus
+// file name, e.g. "github.com/user/repo/internal/foo/bar.go") to its
+// absolute on-disk location.
+//
+// Unlike the old parseGoMod + string-split approach, this uses
+// golang.org/x/tools/go/packages so it follows go.work, vendoring, and
+// replace directives, and also resolves packages outside the main module
+// (standard library, third-party deps covered via -coverpkg).
+type SourceResolver struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string]string // import path -> absolute package directory
+}
+
+// NewSourceResolver creates a resolver that loads packages as seen from dir
+// (normally the directory containing the coverage profile's module).
+func NewSourceResolver(dir string) *SourceResolver {
+	return &SourceResolver{
+		dir:   dir,
+		cache: make(map[string]string),
+	}
+}
+
+// Resolve returns the absolute path of displayFile on disk.
+func (r *SourceResolver) Resolve(displayFile string) (string, error) {
+	importPath, base := splitModuleFile(displayFile)
+
+	dir, err := r.packageDir(importPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, base), nil
+}
+
+func (r *SourceResolver) packageDir(importPath string) (string, error) {
+	r.mu.Lock()
+	dir, ok := r.cache[importPath]
+	r.mu.Unlock()
+	if ok {
+		return dir, nil
+	}
+
+	dir, err := r.loadPackageDir(importPath)
+	if err != nil {
+		var fallbackErr error
+		dir, fallbackErr = fallbackPackageDir(importPath)
+		if fallbackErr != nil {
+			return "", err
+		}
+		logger.Debug("resolver.fallback", "import", importPath, "dir", dir, "loadError", err)
+	}
+
+	r.mu.Lock()
+	r.cache[importPath] = dir
+	r.mu.Unlock()
+
+	return dir, nil
+}
+
+// loadPackageDir asks go/packages for the directory of importPath, honoring
+// GOFLAGS, go.work, and replace directives the same way `go build` would.
+func (r *SourceResolver) loadPackageDir(importPath string) (string, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedFiles | packages.NeedModule | packages.NeedName,
+		Dir:  r.dir,
+	}
+	pkgs, err := packages.Load(cfg, importPath)
+	if err != nil {
+		return "", fmt.Errorf("load package %s: %w", importPath, err)
+	}
+	if len(pkgs) == 0 {
+		return "", fmt.Errorf("package %s not found", importPath)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return "", fmt.Errorf("load package %s: %v", importPath, pkg.Errors[0])
+	}
+	if len(pkg.GoFiles) == 0 {
+		return "", fmt.Errorf("package %s has no Go files", importPath)
+	}
+	return filepath.Dir(pkg.GoFiles[0]), nil
+}
+
+// fallbackPackageDir covers packages go/packages couldn't resolve from
+// r.dir (e.g. a profile produced elsewhere): standard library packages are
+// looked up under GOROOT/src, everything else under GOPATH/pkg/mod.
+func fallbackPackageDir(importPath string) (string, error) {
+	if isStdlibImportPath(importPath) {
+		goroot, err := goEnv("GOROOT")
+		if err != nil {
+			return "", err
+		}
+		dir := filepath.Join(goroot, "src", importPath)
+		if _, err := os.Stat(dir); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+
+	gopath, err := goEnv("GOPATH")
+	if err != nil {
+		return "", err
+	}
+	modRoot := filepath.Join(gopath, "pkg", "mod")
+	dir, err := findModCacheDir(modRoot, importPath)
+	if err != nil {
+		return "", fmt.Errorf("package %s not found under GOROOT or GOPATH/pkg/mod", importPath)
+	}
+	return dir, nil
+}
+
+// findModCacheDir locates importPath under a GOPATH/pkg/mod module cache.
+// Cached module directories are suffixed with the resolved version (e.g.
+// "github.com/user/repo@v1.2.3"), so importPath itself never exists on
+// disk; this tries importPath's directory prefixes from longest to
+// shortest, looking for the one that is a module root (i.e. has an "@"
+// suffix once versioned), then joins back the remaining path segments.
+func findModCacheDir(modRoot, importPath string) (string, error) {
+	segments := strings.Split(importPath, "/")
+	for i := len(segments); i > 0; i-- {
+		prefix := filepath.Join(segments[:i]...)
+		matches, err := filepath.Glob(filepath.Join(modRoot, prefix) + "@*")
+		if err != nil || len(matches) == 0 {
+			continue
+		}
+		dir := filepath.Join(append([]string{matches[0]}, segments[i:]...)...)
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", importPath, modRoot)
+}
+
+// isStdlibImportPath reports whether importPath looks like a standard
+// library path rather than a module path (no dot in the first segment).
+func isStdlibImportPath(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+func goEnv(name string) (string, error) {
+	out, err := exec.Command("go", "env", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("go env %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// splitModuleFile splits "github.com/user/repo/pkg/file.go" into the
+// import path "github.com/user/repo/pkg" and the file base name "file.go".
+func splitModuleFile(displayFile string) (importPath, base string) {
+	idx := strings.LastIndex(displayFile, "/")
+	if idx < 0 {
+		return ".", displayFile
+	}
+	return displayFile[:idx], displayFile[idx+1:]
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFindModCacheDirVersionedModule checks that a package nested under a
+// versioned module cache directory (e.g. "github.com/user/repo@v1.2.3") is
+// found by its unversioned import path, since the module cache never has an
+// exact-match directory for that path.
+func TestFindModCacheDirVersionedModule(t *testing.T) {
+	modRoot := t.TempDir()
+	pkgDir := filepath.Join(modRoot, "github.com", "user", "repo@v1.2.3", "sub", "pkg")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	dir, err := findModCacheDir(modRoot, "github.com/user/repo/sub/pkg")
+	if err != nil {
+		t.Fatalf("findModCacheDir: %v", err)
+	}
+	if dir != pkgDir {
+		t.Errorf("dir = %q, want %q", dir, pkgDir)
+	}
+}
+
+func TestFindModCacheDirNotFound(t *testing.T) {
+	modRoot := t.TempDir()
+	if _, err := findModCacheDir(modRoot, "github.com/user/repo/sub/pkg"); err == nil {
+		t.Fatal("findModCacheDir: want error for missing module, got nil")
+	}
+}
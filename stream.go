@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxScanTokenSize bounds bufio.Scanner so a single pathological profile
+	// line can't trigger bufio.ErrTooLong.
+	maxScanTokenSize = 16 * 1024 * 1024
+	// maxModuleTransitions rejects profiles that never settle on a sane
+	// number of distinct modules, in the same spirit as Go 1.19's stack
+	// depth limits for malformed/adversarial input.
+	maxModuleTransitions = 1_000_000
+)
+
+// parseProfileLine parses one "module:start,end stmts reached" profile
+// line, returning an error instead of panicking on malformed input.
+func parseProfileLine(line string) (*CoverageResult, error) {
+	words := strings.Split(line, " ")
+	if len(words) != 3 {
+		return nil, fmt.Errorf("malformed profile line: %q", line)
+	}
+	infos := strings.SplitN(words[0], ":", 2)
+	if len(infos) != 2 {
+		return nil, fmt.Errorf("malformed profile line: %q", line)
+	}
+	module, startEnd := infos[0], infos[1]
+
+	startEnds := strings.Split(startEnd, ",")
+	if len(startEnds) != 2 {
+		return nil, fmt.Errorf("malformed profile line: %q", line)
+	}
+	s := strings.Split(startEnds[0], ".")
+	e := strings.Split(startEnds[1], ".")
+	if len(s) != 2 || len(e) != 2 {
+		return nil, fmt.Errorf("malformed profile line: %q", line)
+	}
+
+	startLine, err := strconv.Atoi(s[0])
+	if err != nil {
+		return nil, err
+	}
+	startColumn, err := strconv.Atoi(s[1])
+	if err != nil {
+		return nil, err
+	}
+	endLine, err := strconv.Atoi(e[0])
+	if err != nil {
+		return nil, err
+	}
+	endColumn, err := strconv.Atoi(e[1])
+	if err != nil {
+		return nil, err
+	}
+	stmtCount, err := strconv.Atoi(words[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &CoverageResult{
+		Module:      module,
+		StartLine:   uint(startLine),
+		StartColumn: uint(startColumn),
+		EndLine:     uint(endLine),
+		EndColumn:   uint(endColumn),
+		StmtCount:   uint(stmtCount),
+		Reached:     words[2] != "0",
+	}, nil
+}
+
+// scanCoverageResults streams a legacy text profile's blocks over resultc
+// as they're parsed, rather than buffering the whole profile in memory, so
+// a multi-GB monorepo profile doesn't have to fit in RAM at once. resultc
+// is closed when scanning finishes, successfully or not.
+func scanCoverageResults(path string, resultc chan<- *CoverageResult) (mode string, err error) {
+	defer close(resultc)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanTokenSize)
+
+	if !scanner.Scan() {
+		return "", fmt.Errorf("%s: empty profile", path)
+	}
+	modeStr := strings.Split(scanner.Text(), "mode: ")
+	if len(modeStr) < 2 {
+		return "", fmt.Errorf("%s: missing \"mode: \" header", path)
+	}
+	mode = modeStr[1]
+
+	for scanner.Scan() {
+		cov, parseErr := parseProfileLine(scanner.Text())
+		if parseErr != nil {
+			return mode, parseErr
+		}
+		resultc <- cov
+	}
+	return mode, scanner.Err()
+}
+
+// itemCache spills a completed Item's full data (including its line ranges)
+// to a gob file on disk. The in-memory copy kept for the final index holds
+// the summary fields, Functions and CachePath, but not the line ranges.
+// Nothing in this package reads the gob files back: the file's HTML page is
+// rendered from the full Item before it is dropped, and the cache directory
+// is removed when runStreamingPipeline returns.
+type itemCache struct {
+	dir string
+}
+
+func newItemCache() (*itemCache, error) {
+	dir, err := os.MkdirTemp("", "go-cover-coveragepy-stream-*")
+	if err != nil {
+		return nil, err
+	}
+	return &itemCache{dir: dir}, nil
+}
+
+func (c *itemCache) save(item *Item) (string, error) {
+	path := filepath.Join(c.dir, flattenFilename(item.DisplayFile)+".gob")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err := gob.NewEncoder(file).Encode(item); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (c *itemCache) cleanup() {
+	os.RemoveAll(c.dir)
+}
+
+// runStreamingPipeline summarizes profilePath module by module: as soon as
+// a module boundary is seen, its Item is finalized, handed to the worker
+// pool to render as HTML, and spilled to a gob cache file. Memory use stays
+// bounded by the line ranges of the module being read plus those of the
+// modules the workers are rendering (at most jobs of them), rather than the
+// whole profile.
+//
+// This path only covers the common case of a single profile rendered as
+// html: -merge and -diff need full cross-profile context, so main() keeps
+// using the buffered pipeline for those.
+func runStreamingPipeline(profilePath string, resolver *SourceResolver, outputDir string, jobs int) (*Summary, error) {
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		if err := os.Mkdir(outputDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	cache, err := newItemCache()
+	if err != nil {
+		return nil, err
+	}
+	defer cache.cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	worker := startWorker(ctx, wg, jobs)
+
+	tmplFile, err := template.New("file.html").Funcs(funcMap).ParseFS(f, "templates/file.html")
+	if err != nil {
+		return nil, err
+	}
+
+	resultc := make(chan *CoverageResult, 256)
+	var mode string
+	var scanErr error
+	scanDone := make(chan struct{})
+	go func() {
+		mode, scanErr = scanCoverageResults(profilePath, resultc)
+		close(scanDone)
+	}()
+
+	var items []*Item
+	var totalReached, totalMissed, totalStatement, totalAll uint
+	transitions := 0
+
+	var curModule string
+	var lastCov CoverageResult
+	var reachedNum, missedNum uint
+	var reachedRanges, missedRanges []CoverRange
+	var moduleCovResults []*CoverageResult
+	haveModule := false
+
+	flush := func(module string, finishedAllNum uint) error {
+		transitions++
+		if transitions > maxModuleTransitions {
+			return fmt.Errorf("profile spans more than %d modules, refusing to continue", maxModuleTransitions)
+		}
+
+		item := &Item{
+			Reached:       reachedNum,
+			Missed:        missedNum,
+			Statement:     reachedNum + missedNum,
+			All:           finishedAllNum,
+			DisplayFile:   module,
+			HtmlLink:      flattenFilename(module) + ".html",
+			ReachedRanges: reachedRanges,
+			MissedRanges:  missedRanges,
+		}
+		if item.Statement > 0 {
+			item.Percentage = uint(math.Round(float64(item.Reached) / float64(item.Statement) * 100))
+		}
+
+		if funcItems, funcErr := moduleFunctionCoverage(resolver, module, moduleCovResults); funcErr != nil {
+			logger.Error("function coverage error", "module", module, "error", funcErr)
+		} else {
+			item.Functions = funcItems
+		}
+
+		wg.Add(1)
+		worker <- &WorkerProcessRequest{
+			tmplFile:       tmplFile,
+			outputFilename: filepath.Join(outputDir, item.HtmlLink),
+			resolver:       resolver,
+			item:           item,
+		}
+
+		cachePath, cacheErr := cache.save(item)
+		if cacheErr != nil {
+			return cacheErr
+		}
+
+		indexItem := *item
+		indexItem.CachePath = cachePath
+		indexItem.ReachedRanges = nil
+		indexItem.MissedRanges = nil
+		items = append(items, &indexItem)
+
+		totalReached += item.Reached
+		totalMissed += item.Missed
+		totalStatement += item.Statement
+		totalAll += item.All
+
+		return nil
+	}
+
+	for cov := range resultc {
+		if !haveModule {
+			curModule = cov.Module
+			haveModule = true
+		} else if cov.Module != curModule {
+			if err := flush(curModule, lastCov.EndLine); err != nil {
+				return nil, err
+			}
+			reachedNum, missedNum = 0, 0
+			reachedRanges, missedRanges = nil, nil
+			moduleCovResults = nil
+			curModule = cov.Module
+		}
+
+		if cov.Reached {
+			reachedNum += cov.StmtCount
+			reachedRanges = append(reachedRanges, CoverRange{Start: cov.StartLine, End: cov.EndLine})
+		} else {
+			missedNum += cov.StmtCount
+			missedRanges = append(missedRanges, CoverRange{Start: cov.StartLine, End: cov.EndLine})
+		}
+		moduleCovResults = append(moduleCovResults, cov)
+		lastCov = *cov
+	}
+	<-scanDone
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	if haveModule {
+		finishedAllNum := lastCov.EndLine
+		if !lastCov.Reached {
+			finishedAllNum++
+		}
+		if err := flush(curModule, finishedAllNum); err != nil {
+			return nil, err
+		}
+	}
+
+	wg.Wait()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].DisplayFile < items[j].DisplayFile })
+
+	now := time.Now()
+	summary := &Summary{
+		Mode: mode,
+		Total: TotalItem{
+			All:        totalAll,
+			Statement:  totalStatement,
+			Reached:    totalReached,
+			Missed:     totalMissed,
+			Excluded:   totalAll - totalReached - totalMissed,
+			Percentage: uint(math.Round(float64(totalReached) / float64(totalStatement) * 100)),
+		},
+		Items:     items,
+		CreatedAt: &now,
+	}
+
+	if err := writeIndexFile(outputDir, summary); err != nil {
+		return nil, err
+	}
+	if err := writeFunctionsFile(outputDir, summary); err != nil {
+		return nil, err
+	}
+	if err := writeStaticFiles(outputDir); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseProfileLine(t *testing.T) {
+	cov, err := parseProfileLine("example.com/pkg/foo.go:1.1,5.2 3 1")
+	if err != nil {
+		t.Fatalf("parseProfileLine: %v", err)
+	}
+	want := &CoverageResult{
+		Module:      "example.com/pkg/foo.go",
+		StartLine:   1,
+		StartColumn: 1,
+		EndLine:     5,
+		EndColumn:   2,
+		StmtCount:   3,
+		Reached:     true,
+	}
+	if *cov != *want {
+		t.Errorf("cov = %+v, want %+v", cov, want)
+	}
+}
+
+func TestParseProfileLineMalformed(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"example.com/pkg/foo.go 3 1",
+		"example.com/pkg/foo.go:1.1,5.2 3",
+		"example.com/pkg/foo.go:1,5 3 1",
+	} {
+		if _, err := parseProfileLine(line); err == nil {
+			t.Errorf("parseProfileLine(%q): want error, got nil", line)
+		}
+	}
+}
+
+// TestScanCoverageResultsMatchesBufferedParse checks that the streaming
+// scanner produces the same blocks as the buffered parseProfileFile for the
+// same input, since the two are expected to agree on every non-merge/-diff
+// code path.
+func TestScanCoverageResultsMatchesBufferedParse(t *testing.T) {
+	path := filepath.Join("testdata", "sample.cov")
+
+	wantMode, want, err := parseProfileFile(path)
+	if err != nil {
+		t.Fatalf("parseProfileFile: %v", err)
+	}
+
+	resultc := make(chan *CoverageResult, 16)
+	var got []*CoverageResult
+	done := make(chan struct{})
+	var mode string
+	var scanErr error
+	go func() {
+		mode, scanErr = scanCoverageResults(path, resultc)
+		close(done)
+	}()
+	for cov := range resultc {
+		got = append(got, cov)
+	}
+	<-done
+
+	if scanErr != nil {
+		t.Fatalf("scanCoverageResults: %v", scanErr)
+	}
+	if mode != wantMode {
+		t.Errorf("mode = %q, want %q", mode, wantMode)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != *want[i] {
+			t.Errorf("block[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestRunStreamingPipelineEndToEnd exercises the streaming pipeline against
+// a real profile and checks it actually writes an HTML report, the same way
+// the buffered HTMLReporter.Report path is checked in report_test.go. The
+// two pipelines share the same file.html/static templates, so this guards
+// against -stream breaking independently of -format html.
+func TestRunStreamingPipelineEndToEnd(t *testing.T) {
+	outputDir := t.TempDir()
+	resolver := NewSourceResolver(".")
+
+	summary, err := runStreamingPipeline(filepath.Join("testdata", "stream_sample.cov"), resolver, outputDir, 1)
+	if err != nil {
+		t.Fatalf("runStreamingPipeline: %v", err)
+	}
+	if len(summary.Items) != 1 || summary.Items[0].DisplayFile != "fmt/print.go" {
+		t.Fatalf("summary.Items = %+v, want one item for fmt/print.go", summary.Items)
+	}
+
+	for _, name := range []string{
+		"index.html",
+		"functions.html",
+		"style.css",
+		flattenFilename("fmt/print.go") + ".html",
+	} {
+		path := filepath.Join(outputDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", path)
+		}
+	}
+
+	body, err := os.ReadFile(filepath.Join(outputDir, flattenFilename("fmt/print.go")+".html"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(body), `class="run"`) {
+		t.Error("file.html output missing highlighted line class \"run\"")
+	}
+}
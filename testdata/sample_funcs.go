@@ -0,0 +1,9 @@
+package testdata
+
+func Add(a, b int) int {
+	return a + b
+}
+
+func Sub(a, b int) int {
+	return a - b
+}